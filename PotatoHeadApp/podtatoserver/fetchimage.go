@@ -0,0 +1,278 @@
+package podtatoserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/podtato-head/podtato-head-app/pkg/handlers"
+	"github.com/podtato-head/podtato-head-app/pkg/services"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// fetchCacheTTL is how long a successful part-service response is
+	// reused before the next render triggers a fresh fetch.
+	fetchCacheTTL = 5 * time.Second
+
+	// fetchTimeout bounds how long a single component fetch may take
+	// before the render gives up on it and falls back to a placeholder.
+	fetchTimeout = 2 * time.Second
+
+	// circuitFailureThreshold is how many consecutive failures trip a
+	// component's circuit breaker open.
+	circuitFailureThreshold = 3
+
+	// circuitCooldown is how long an open breaker stays open before a
+	// single half-open probe is allowed through.
+	circuitCooldown = 10 * time.Second
+)
+
+var (
+	fetchDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "fetch_duration_seconds",
+		Help: "Duration of part-service fetches, by component.",
+	}, []string{"component"})
+
+	fetchErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "fetch_errors_total",
+		Help: "Number of failed part-service fetches, by component.",
+	}, []string{"component"})
+
+	circuitStateGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "circuit_state",
+		Help: "Circuit breaker state per component (0=closed, 1=half-open, 2=open).",
+	}, []string{"component"})
+)
+
+func init() {
+	prometheus.MustRegister(fetchDurationSeconds, fetchErrorsTotal, circuitStateGauge)
+}
+
+// partResult is the trio of fields frontendHandler needs for a single
+// body part, whether it came from a live fetch, the cache, or a
+// placeholder standing in for a failed/tripped component.
+type partResult struct {
+	Image    string
+	Hostname string
+	Version  string
+}
+
+func placeholderResult() partResult {
+	return partResult{Image: "placeholder.png"}
+}
+
+type cacheEntry struct {
+	result    partResult
+	expiresAt time.Time
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerHalfOpen
+	breakerOpen
+)
+
+// circuitBreaker is a simple closed/open/half-open breaker guarding calls
+// to a single downstream component.
+type circuitBreaker struct {
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+}
+
+// allow reports whether a call should be attempted right now. When the
+// cooldown on an open breaker has elapsed, exactly one caller is admitted
+// as the half-open probe (the one that performs the state transition,
+// under the same lock); every other concurrent caller sees the breaker
+// already half-open and is refused until that single probe resolves via
+// recordSuccess or recordFailure. This avoids a thundering herd hitting a
+// still-recovering component the moment the cooldown expires.
+func (b *circuitBreaker) allow(component string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < circuitCooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		circuitStateGauge.WithLabelValues(component).Set(float64(breakerHalfOpen))
+		return true
+	case breakerHalfOpen:
+		return false
+	default:
+		return true
+	}
+}
+
+func (b *circuitBreaker) recordSuccess(component string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.state = breakerClosed
+	circuitStateGauge.WithLabelValues(component).Set(float64(breakerClosed))
+}
+
+func (b *circuitBreaker) recordFailure(component string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= circuitFailureThreshold {
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+		circuitStateGauge.WithLabelValues(component).Set(float64(breakerOpen))
+	}
+}
+
+// partFetcher concurrently fetches part images from the downstream
+// leg/arm/hat services, memoizing recent results in a TTL cache and
+// short-circuiting calls to components that are currently failing.
+type partFetcher struct {
+	mu       sync.Mutex
+	cache    map[string]cacheEntry
+	breakers map[string]*circuitBreaker
+}
+
+func newPartFetcher() *partFetcher {
+	return &partFetcher{
+		cache:    make(map[string]cacheEntry),
+		breakers: make(map[string]*circuitBreaker),
+	}
+}
+
+func (f *partFetcher) breakerFor(component string) *circuitBreaker {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	b, ok := f.breakers[component]
+	if !ok {
+		b = &circuitBreaker{}
+		f.breakers[component] = b
+	}
+	return b
+}
+
+func (f *partFetcher) cached(component string) (partResult, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	entry, ok := f.cache[component]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return partResult{}, false
+	}
+	return entry.result, true
+}
+
+func (f *partFetcher) store(component string, result partResult) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.cache[component] = cacheEntry{result: result, expiresAt: time.Now().Add(fetchCacheTTL)}
+}
+
+// FetchAll fetches every component concurrently and returns one
+// partResult per component, in the same order as components. Components
+// that are cached, rate-limited by an open circuit, or fail outright
+// resolve to a cached or placeholder result rather than failing the
+// whole render.
+func (f *partFetcher) FetchAll(ctx context.Context, p PodTatoServer, refID string, components []string) []partResult {
+	results := make([]partResult, len(components))
+
+	g, gctx := errgroup.WithContext(ctx)
+	for i, component := range components {
+		i, component := i, component
+		g.Go(func() error {
+			results[i] = f.fetchOne(gctx, p, refID, component)
+			return nil
+		})
+	}
+	_ = g.Wait() // fetchOne always resolves to a result, it never returns an error
+
+	return results
+}
+
+func (f *partFetcher) fetchOne(ctx context.Context, p PodTatoServer, refID, component string) partResult {
+	if cached, ok := f.cached(component); ok {
+		return cached
+	}
+
+	breaker := f.breakerFor(component)
+	if !breaker.allow(component) {
+		return placeholderResult()
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	start := time.Now()
+	result, err := fetchImageFrom(callCtx, p, refID, component)
+	fetchDurationSeconds.WithLabelValues(component).Observe(time.Since(start).Seconds())
+	if err != nil {
+		fetchErrorsTotal.WithLabelValues(component).Inc()
+		breaker.recordFailure(component)
+		return placeholderResult()
+	}
+
+	breaker.recordSuccess(component)
+	f.store(component, result)
+	return result
+}
+
+// fetchImageFrom performs the actual HTTP round trip to a single part
+// service: discover its address, GET its image, decode the response.
+func fetchImageFrom(ctx context.Context, p PodTatoServer, refID, component string) (partResult, error) {
+	var serviceDiscoverer services.ServiceMap
+	var err error
+	if p.Component == "all" {
+		serviceDiscoverer, err = services.NewLocalServiceDiscoverer(p.Port)
+	} else {
+		serviceDiscoverer, err = services.ProvideServiceDiscoverer()
+	}
+	if err != nil {
+		return partResult{}, fmt.Errorf("failed to get service discoverer: %w", err)
+	}
+
+	rootURL, err := serviceDiscoverer.GetServiceAddress(component)
+	if err != nil {
+		return partResult{}, fmt.Errorf("failed to discover address for service %s: %w", component, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		fmt.Sprintf("%s/images/%s/%s", rootURL, component, component), nil)
+	if err != nil {
+		return partResult{}, fmt.Errorf("failed to build request for dependency service: %w", err)
+	}
+	if refID != "" {
+		req.Header.Set(referenceIDHeader, refID+"."+component)
+	}
+
+	response, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return partResult{}, fmt.Errorf("failed to reach dependency service: %w", err)
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return partResult{}, fmt.Errorf("failed to read body of dependency service response: %w", err)
+	}
+
+	part := handlers.PartResponse{}
+	if err := json.Unmarshal(body, &part); err != nil {
+		return partResult{}, fmt.Errorf("failed to unmarshal body of dependency service response: %w", err)
+	}
+
+	return partResult{Image: part.Image, Hostname: part.ServedBy, Version: part.Version}, nil
+}
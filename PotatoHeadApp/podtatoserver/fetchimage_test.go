@@ -0,0 +1,105 @@
+package podtatoserver
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker_TripsOpenAfterThreshold(t *testing.T) {
+	b := &circuitBreaker{}
+
+	for i := 0; i < circuitFailureThreshold-1; i++ {
+		if !b.allow("test") {
+			t.Fatalf("expected breaker to allow call %d before threshold is reached", i)
+		}
+		b.recordFailure("test")
+	}
+	if b.state != breakerClosed {
+		t.Fatalf("expected breaker to still be closed just below threshold, got state %v", b.state)
+	}
+
+	if !b.allow("test") {
+		t.Fatal("expected breaker to allow the call that trips it")
+	}
+	b.recordFailure("test")
+
+	if b.state != breakerOpen {
+		t.Fatalf("expected breaker to be open after %d consecutive failures, got state %v", circuitFailureThreshold, b.state)
+	}
+	if b.allow("test") {
+		t.Fatal("expected an open breaker within its cooldown to refuse calls")
+	}
+}
+
+func TestCircuitBreaker_SuccessResetsFailureCount(t *testing.T) {
+	b := &circuitBreaker{}
+
+	b.allow("test")
+	b.recordFailure("test")
+	b.allow("test")
+	b.recordFailure("test")
+	b.allow("test")
+	b.recordSuccess("test")
+
+	if b.failures != 0 {
+		t.Fatalf("expected recordSuccess to reset the failure count, got %d", b.failures)
+	}
+	if b.state != breakerClosed {
+		t.Fatalf("expected breaker to be closed after a success, got state %v", b.state)
+	}
+}
+
+func TestCircuitBreaker_AdmitsOnlyOneHalfOpenProbePerCooldown(t *testing.T) {
+	b := &circuitBreaker{state: breakerOpen, openedAt: time.Now().Add(-2 * circuitCooldown)}
+
+	admitted := 0
+	for i := 0; i < 5; i++ {
+		if b.allow("test") {
+			admitted++
+		}
+	}
+
+	if admitted != 1 {
+		t.Fatalf("expected exactly one caller to be admitted as the half-open probe, got %d", admitted)
+	}
+	if b.state != breakerHalfOpen {
+		t.Fatalf("expected breaker to be half-open after the cooldown elapses, got state %v", b.state)
+	}
+}
+
+func TestCircuitBreaker_HalfOpenProbeFailureReopensBreaker(t *testing.T) {
+	b := &circuitBreaker{state: breakerOpen, openedAt: time.Now().Add(-2 * circuitCooldown)}
+
+	if !b.allow("test") {
+		t.Fatal("expected the probe call to be admitted")
+	}
+	b.recordFailure("test")
+
+	if b.state != breakerOpen {
+		t.Fatalf("expected a failed probe to reopen the breaker, got state %v", b.state)
+	}
+}
+
+func TestPartFetcher_CacheServesWithinTTLAndExpiresAfter(t *testing.T) {
+	f := newPartFetcher()
+	want := partResult{Image: "leg.png", Hostname: "host-1", Version: "v1"}
+	f.store("left-leg", want)
+
+	got, ok := f.cached("left-leg")
+	if !ok {
+		t.Fatal("expected a cached entry immediately after storing it")
+	}
+	if got != want {
+		t.Fatalf("expected cached result %+v, got %+v", want, got)
+	}
+
+	f.mu.Lock()
+	entry := f.cache["left-leg"]
+	entry.expiresAt = time.Now().Add(-time.Second)
+	f.cache["left-leg"] = entry
+	f.mu.Unlock()
+
+	if _, ok := f.cached("left-leg"); ok {
+		t.Fatal("expected an expired cache entry to miss")
+	}
+}
@@ -0,0 +1,48 @@
+package podtatoserver
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// IdleTracker counts in-flight requests and reports how long the server has
+// been completely idle. It is used to drive on-demand deployments that
+// should exit a short while after the last request finishes, in addition to
+// the usual Kubernetes readiness/liveness lifecycle.
+type IdleTracker struct {
+	active   int64
+	lastIdle atomic.Value // time.Time
+}
+
+// NewIdleTracker creates a tracker that considers the server idle starting
+// from the moment it is created.
+func NewIdleTracker() *IdleTracker {
+	t := &IdleTracker{}
+	t.lastIdle.Store(time.Now())
+	return t
+}
+
+// Middleware wraps next, incrementing the active-request counter for the
+// duration of the request and recording the time the server goes back to
+// idle once the last in-flight request completes.
+func (t *IdleTracker) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&t.active, 1)
+		defer func() {
+			if atomic.AddInt64(&t.active, -1) == 0 {
+				t.lastIdle.Store(time.Now())
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// IdleSince returns how long the server has had zero in-flight requests. It
+// returns 0 if a request is currently being served.
+func (t *IdleTracker) IdleSince() time.Duration {
+	if atomic.LoadInt64(&t.active) > 0 {
+		return 0
+	}
+	return time.Since(t.lastIdle.Load().(time.Time))
+}
@@ -0,0 +1,78 @@
+package podtatoserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIdleTracker_IdleSinceZeroWhileRequestInFlight(t *testing.T) {
+	tracker := NewIdleTracker()
+	release := make(chan struct{})
+
+	handler := tracker.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		close(done)
+	}()
+
+	// Give the handler goroutine a moment to register as active.
+	time.Sleep(10 * time.Millisecond)
+
+	if got := tracker.IdleSince(); got != 0 {
+		t.Fatalf("expected IdleSince to be 0 while a request is in flight, got %v", got)
+	}
+
+	close(release)
+	<-done
+}
+
+func TestIdleTracker_IdleSinceGrowsAfterLastRequestCompletes(t *testing.T) {
+	tracker := NewIdleTracker()
+
+	handler := tracker.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	time.Sleep(10 * time.Millisecond)
+
+	if got := tracker.IdleSince(); got < 10*time.Millisecond {
+		t.Fatalf("expected IdleSince to have grown past 10ms, got %v", got)
+	}
+}
+
+func TestIdleTracker_ConcurrentRequestsKeepTrackerBusyUntilLastOneFinishes(t *testing.T) {
+	tracker := NewIdleTracker()
+	release := make(chan struct{})
+
+	handler := tracker.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+
+	const concurrent = 5
+	done := make(chan struct{}, concurrent)
+	for i := 0; i < concurrent; i++ {
+		go func() {
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+			done <- struct{}{}
+		}()
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if got := tracker.IdleSince(); got != 0 {
+		t.Fatalf("expected IdleSince to be 0 with requests in flight, got %v", got)
+	}
+
+	close(release)
+	for i := 0; i < concurrent; i++ {
+		<-done
+	}
+
+	if got := tracker.IdleSince(); got == 0 {
+		t.Fatalf("expected IdleSince to be nonzero once every request has completed")
+	}
+}
@@ -1,27 +1,36 @@
 package podtatoserver
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/gorilla/mux"
 	"github.com/podtato-head/podtato-head-app/pkg/assets"
 	"github.com/podtato-head/podtato-head-app/pkg/handlers"
 	metrics "github.com/podtato-head/podtato-head-app/pkg/metrics"
-	"github.com/podtato-head/podtato-head-app/pkg/services"
 	"github.com/podtato-head/podtato-head-app/pkg/version"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/pterm/pterm"
 	"html/template"
-	"io"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
 	"sync/atomic"
+	"syscall"
 	"time"
 )
 
 const (
 	assetsPrefix = "/assets"
+
+	// defaultShutdownTimeout bounds how long Serve waits for in-flight
+	// requests (e.g. an upstream /images/... fetch) to finish once a
+	// termination signal is received.
+	defaultShutdownTimeout = 15 * time.Second
+
+	idlePollInterval = time.Second
 )
 
 type PodTatoServer struct {
@@ -29,8 +38,38 @@ type PodTatoServer struct {
 	Port          string
 	StartUpDelay  string
 	SecretMessage string
+
+	// ShutdownTimeout is how long Serve waits for in-flight requests to
+	// drain after SIGTERM/SIGINT before it stops waiting and returns the
+	// shutdown error.
+	// Parsed with time.ParseDuration; defaults to defaultShutdownTimeout
+	// when empty.
+	ShutdownTimeout string
+
+	// IdleShutdownTimeout, when set, causes Serve to return on its own
+	// once the server has had no in-flight requests for this long. This
+	// is meant for on-demand deployments that should scale themselves
+	// back to zero. Parsed with time.ParseDuration; idle-shutdown is
+	// disabled when empty.
+	IdleShutdownTimeout string
+
+	// fetcher holds the cache and circuit breakers shared by every
+	// frontendHandler call. It's initialized once in Serve.
+	fetcher *partFetcher
+
+	// template is podtato-home.html, parsed once in Serve so that
+	// rendering a page doesn't pay template-parse cost on every request.
+	template *template.Template
 }
 
+// partComponents lists the body parts frontendHandler assembles a page
+// from, in the order fetched results are mapped back onto TemplateData.
+var partComponents = []string{"left-arm", "right-arm", "left-leg", "right-leg", "hat"}
+
+// hostnameFunc is overridden in tests to exercise buildTemplateData's
+// error path without depending on the real environment.
+var hostnameFunc = os.Hostname
+
 type TemplateData struct {
 	Version          string
 	Hostname         string
@@ -53,51 +92,92 @@ type TemplateData struct {
 	SecretMessage    string
 }
 
-func (p PodTatoServer) frontendHandler(w http.ResponseWriter, r *http.Request) {
-
-	homeTemplate, err := template.ParseFS(assets.Assets, "html/podtato-home.html")
+// buildTemplateData assembles the data needed to render either the HTML
+// page or its JSON equivalent: the local hostname plus the five part
+// images fetched (possibly concurrently, possibly from cache) via
+// p.fetcher.
+func (p PodTatoServer) buildTemplateData(r *http.Request) (TemplateData, error) {
+	hostname, err := hostnameFunc()
 	if err != nil {
-		log.Fatalf("failed to parse file: %v", err)
+		return TemplateData{}, fmt.Errorf("failed to get hostname: %w", err)
 	}
 
-	hostname, err := os.Hostname()
-	if err != nil {
-		log.Fatalf("failed to get hostname: %v", err)
-	}
-
-	leftArmImage, leftArmHost, leftArmVersion := p.fetchImage("left-arm")
-	rightArmImage, rightArmHost, rightArmVersion := p.fetchImage("right-arm")
-	leftLegImage, leftLegHost, leftLegVersion := p.fetchImage("left-leg")
-	rightLegImage, rightLegHost, rightLegVersion := p.fetchImage("right-leg")
-	hatImage, hatHost, hatVersion := p.fetchImage("hat")
-	tpl := TemplateData{
-		LeftArm:          leftArmImage,
-		RightArm:         rightArmImage,
-		LeftLeg:          leftLegImage,
-		RightLeg:         rightLegImage,
-		Hat:              hatImage,
-		LeftArmHostname:  leftArmHost,
-		RightArmHostname: rightArmHost,
-		LeftLegHostname:  leftLegHost,
-		RightLegHostname: rightLegHost,
-		HatHostname:      hatHost,
-		LeftArmVersion:   leftArmVersion,
-		RightArmVersion:  rightArmVersion,
-		LeftLegVersion:   leftLegVersion,
-		RightLegVersion:  rightLegVersion,
-		HatVersion:       hatVersion,
+	refID := referenceIDFromContext(r.Context())
+
+	parts := p.fetcher.FetchAll(r.Context(), p, refID, partComponents)
+	leftArm, rightArm, leftLeg, rightLeg, hat := parts[0], parts[1], parts[2], parts[3], parts[4]
+
+	return TemplateData{
+		LeftArm:          leftArm.Image,
+		RightArm:         rightArm.Image,
+		LeftLeg:          leftLeg.Image,
+		RightLeg:         rightLeg.Image,
+		Hat:              hat.Image,
+		LeftArmHostname:  leftArm.Hostname,
+		RightArmHostname: rightArm.Hostname,
+		LeftLegHostname:  leftLeg.Hostname,
+		RightLegHostname: rightLeg.Hostname,
+		HatHostname:      hat.Hostname,
+		LeftArmVersion:   leftArm.Version,
+		RightArmVersion:  rightArm.Version,
+		LeftLegVersion:   leftLeg.Version,
+		RightLegVersion:  rightLeg.Version,
+		HatVersion:       hat.Version,
 		Hostname:         hostname,
 		Daytime:          getDayTime(),
 		Version:          version.ServiceVersion(),
 		SecretMessage:    p.SecretMessage,
+	}, nil
+}
+
+func (p PodTatoServer) frontendHandler(w http.ResponseWriter, r *http.Request) {
+	if wantsJSON(r) {
+		p.partsAPIHandler(w, r)
+		return
 	}
 
-	err = homeTemplate.Execute(w, tpl)
+	tpl, err := p.buildTemplateData(r)
 	if err != nil {
-		log.Fatalf("failed to execute template: %v", err)
+		p.writeError(w, r, "failed to build template data", err)
+		return
+	}
+
+	if err := p.template.Execute(w, tpl); err != nil {
+		p.writeError(w, r, "failed to execute template", err)
+		return
 	}
 }
 
+// partsAPIHandler serves the same data frontendHandler renders into HTML,
+// as JSON, for GET /api/v1/parts and for "/" when the caller sends
+// Accept: application/json.
+func (p PodTatoServer) partsAPIHandler(w http.ResponseWriter, r *http.Request) {
+	tpl, err := p.buildTemplateData(r)
+	if err != nil {
+		p.writeError(w, r, "failed to build template data", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(tpl); err != nil {
+		log.Printf("ref-id=%s failed to encode parts response: %v", referenceIDFromContext(r.Context()), err)
+	}
+}
+
+// writeError logs a failure with its reference ID and returns it to the
+// caller as a 500, instead of crashing the handler goroutine.
+func (p PodTatoServer) writeError(w http.ResponseWriter, r *http.Request, message string, err error) {
+	log.Printf("ref-id=%s %s: %v", referenceIDFromContext(r.Context()), message, err)
+	http.Error(w, message, http.StatusInternalServerError)
+}
+
+// wantsJSON reports whether the caller asked for application/json via the
+// Accept header, used to let "/" double as the JSON API for callers that
+// prefer content negotiation over a dedicated path.
+func wantsJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
 func getDayTime() string {
 	hour := time.Now().Hour()
 	if hour < 12 {
@@ -114,29 +194,51 @@ func (p PodTatoServer) Serve() error {
 	isReady := &atomic.Value{}
 	isReady.Store(false)
 
+	p.fetcher = newPartFetcher()
+
+	homeTemplate, err := template.ParseFS(assets.Assets, "html/podtato-home.html")
+	if err != nil {
+		return err
+	}
+	p.template = homeTemplate
+
 	router := mux.NewRouter()
 	router.Use(metrics.MetricsHandler)
+	router.Use(RequestLoggingMiddleware(stdRequestLogger{}))
+	router.Use(recoveryMiddleware)
 	router.Path("/metrics").Handler(promhttp.Handler())
 	router.Path("/healthz").HandlerFunc(handlers.HealthHandler)
 
+	// idleTracker only wraps handlers that serve actual application
+	// traffic. /healthz, /readyz and /metrics are polled on a fixed
+	// interval by Kubernetes probes and Prometheus regardless of whether
+	// anyone is using the app, so counting them as activity would mean
+	// IdleShutdownTimeout never fires once those probes are configured.
+	idleTracker := NewIdleTracker()
+	traffic := func(h http.HandlerFunc) http.Handler {
+		return idleTracker.Middleware(h)
+	}
+
 	switch p.Component {
 	case "all":
-		router.Path("/").HandlerFunc(p.frontendHandler)
+		router.Path("/").Handler(traffic(p.frontendHandler))
+		router.Path("/api/v1/parts").Handler(traffic(p.partsAPIHandler))
 
 		// serve CSS and images
 		router.PathPrefix(assetsPrefix).
-			Handler(http.StripPrefix(assetsPrefix, http.FileServer(http.FS(assets.Assets))))
+			Handler(idleTracker.Middleware(http.StripPrefix(assetsPrefix, http.FileServer(http.FS(assets.Assets)))))
 
-		router.Path("/images/{partName}/{partName}").HandlerFunc(handlers.PartHandler)
+		router.Path("/images/{partName}/{partName}").Handler(traffic(handlers.PartHandler))
 
 		pterm.DefaultCenter.Println("Will listen on port " + p.Port + " in monolith mode")
 
 	case "frontend":
-		router.Path("/").HandlerFunc(p.frontendHandler)
+		router.Path("/").Handler(traffic(p.frontendHandler))
+		router.Path("/api/v1/parts").Handler(traffic(p.partsAPIHandler))
 
 		// serve CSS and images
 		router.PathPrefix(assetsPrefix).
-			Handler(http.StripPrefix(assetsPrefix, http.FileServer(http.FS(assets.Assets))))
+			Handler(idleTracker.Middleware(http.StripPrefix(assetsPrefix, http.FileServer(http.FS(assets.Assets)))))
 
 		pterm.DefaultCenter.Println("Will listen on port " + p.Port + " in frontend mode")
 
@@ -144,7 +246,7 @@ func (p PodTatoServer) Serve() error {
 		router.PathPrefix(assetsPrefix).
 			Handler(http.StripPrefix(assetsPrefix, http.FileServer(http.FS(assets.Assets))))
 
-		router.Path(fmt.Sprintf("/images/%s/{partName}", p.Component)).HandlerFunc(handlers.PartHandler)
+		router.Path(fmt.Sprintf("/images/%s/{partName}", p.Component)).Handler(traffic(handlers.PartHandler))
 
 		pterm.DefaultCenter.Println("Will listen on port " + p.Port + " for " + p.Component + " service")
 	}
@@ -165,54 +267,75 @@ func (p PodTatoServer) Serve() error {
 
 	router.Path("/readyz").HandlerFunc(handlers.ReadinessHandler(isReady))
 
-	// Start server
-	if err := http.ListenAndServe(fmt.Sprintf(":%s", p.Port), router); err != nil {
-		return err
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%s", p.Port),
+		Handler: router,
 	}
-	return nil
-}
 
-func (p PodTatoServer) fetchImage(component string) (string, string, string) {
-	var serviceDiscoverer services.ServiceMap
-	var err error
-	if p.Component == "all" {
-		serviceDiscoverer, err = services.NewLocalServiceDiscoverer(p.Port)
+	shutdownTimeout := defaultShutdownTimeout
+	if p.ShutdownTimeout != "" {
+		d, err := time.ParseDuration(p.ShutdownTimeout)
 		if err != nil {
-			log.Printf("failed to get service discoverer: %v", err)
-			return "", "", ""
-
+			return err
 		}
-	} else {
-		serviceDiscoverer, err = services.ProvideServiceDiscoverer()
+		shutdownTimeout = d
+	}
+
+	var idleShutdownTimeout time.Duration
+	if p.IdleShutdownTimeout != "" {
+		d, err := time.ParseDuration(p.IdleShutdownTimeout)
 		if err != nil {
-			log.Printf("failed to get service discoverer: %v", err)
-			return "", "", ""
+			return err
 		}
-	}
-	rootURL, err := serviceDiscoverer.GetServiceAddress(component)
-	if err != nil {
-		log.Printf("failed to discover address for service %s", component)
-		return "", "", ""
+		idleShutdownTimeout = d
 	}
 
-	response, err := http.Get(fmt.Sprintf("%s/images/%s/%s", rootURL, component, component))
-	if err != nil {
-		log.Printf("failed to reach dependency service: %v", err)
-		return "", "", ""
-	}
+	shutdown := make(chan error, 1)
+	go func() {
+		sigCh := make(chan os.Signal, 1)
+		signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT)
 
-	body, err := io.ReadAll(response.Body)
-	if err != nil {
-		log.Printf("failed to read body of dependency service response: %v", err)
-		return "", "", ""
+		select {
+		case <-sigCh:
+			pterm.DefaultCenter.Println("Received termination signal, draining connections")
+		case <-waitForIdleShutdown(idleTracker, idleShutdownTimeout):
+			pterm.DefaultCenter.Println("Idle timeout reached, shutting down")
+		}
+
+		// Flip readiness off first so kube-proxy stops sending new
+		// traffic while we drain what's already in flight.
+		isReady.Store(false)
+
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		shutdown <- server.Shutdown(ctx)
+	}()
+
+	// Start server
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
 	}
-	defer response.Body.Close()
 
-	part := handlers.PartResponse{}
-	err = json.Unmarshal(body, &part)
-	if err != nil {
-		log.Printf("failed to unmarshal body of dependency service response: %v", err)
-		return "", "", ""
+	return <-shutdown
+}
+
+// waitForIdleShutdown returns a channel that closes once the tracker has
+// been idle for timeout. When timeout is zero (idle-shutdown disabled) the
+// channel is never closed.
+func waitForIdleShutdown(tracker *IdleTracker, timeout time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+	if timeout <= 0 {
+		return done
 	}
-	return part.Image, part.ServedBy, part.Version
+	go func() {
+		ticker := time.NewTicker(idlePollInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if tracker.IdleSince() >= timeout {
+				close(done)
+				return
+			}
+		}
+	}()
+	return done
 }
@@ -0,0 +1,69 @@
+package podtatoserver
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFrontendHandler_HostnameErrorReturns500(t *testing.T) {
+	original := hostnameFunc
+	hostnameFunc = func() (string, error) { return "", errors.New("forced hostname failure") }
+	defer func() { hostnameFunc = original }()
+
+	p := PodTatoServer{fetcher: newPartFetcher(), template: template.Must(template.New("home").Parse("ok"))}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+
+	p.frontendHandler(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status %d, got %d", http.StatusInternalServerError, rec.Code)
+	}
+}
+
+func TestFrontendHandler_TemplateExecuteErrorReturns500(t *testing.T) {
+	p := PodTatoServer{
+		fetcher:  fetcherWithAllComponentsCached(),
+		template: template.Must(template.New("home").Parse("{{.Missing.Field}}")),
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+
+	p.frontendHandler(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status %d, got %d", http.StatusInternalServerError, rec.Code)
+	}
+}
+
+// fetcherWithAllComponentsCached returns a partFetcher with every
+// component in partComponents already in its cache, so FetchAll resolves
+// entirely from memory instead of reaching out to service discovery and
+// the network, keeping handler tests hermetic.
+func fetcherWithAllComponentsCached() *partFetcher {
+	f := newPartFetcher()
+	for _, component := range partComponents {
+		f.store(component, partResult{Image: component + ".png", Hostname: "test-host", Version: "test"})
+	}
+	return f
+}
+
+func TestRecoveryMiddleware_RecoversPanic(t *testing.T) {
+	handler := recoveryMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status %d, got %d", http.StatusInternalServerError, rec.Code)
+	}
+}
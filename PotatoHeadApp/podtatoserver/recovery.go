@@ -0,0 +1,21 @@
+package podtatoserver
+
+import (
+	"log"
+	"net/http"
+)
+
+// recoveryMiddleware turns a panic anywhere downstream into a 500 response
+// instead of crashing the pod, logging the reference ID so the failure can
+// be correlated with the request that triggered it.
+func recoveryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				log.Printf("ref-id=%s panic recovered: %v", referenceIDFromContext(r.Context()), rec)
+				http.Error(w, "internal server error", http.StatusInternalServerError)
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,115 @@
+package podtatoserver
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"time"
+)
+
+// referenceIDHeader carries an identifier that correlates a single
+// frontend render with the downstream part-service requests it fans out
+// to, so a failure in one leg/arm/hat pod can be traced back to the
+// request that triggered it.
+const referenceIDHeader = "X-Reference-Id"
+
+type referenceIDKey struct{}
+
+// RequestLogger logs a single completed HTTP request. It is pluggable so
+// callers can swap in a structured (e.g. JSON) logger without touching the
+// middleware itself.
+type RequestLogger interface {
+	Log(entry RequestLogEntry)
+}
+
+// RequestLogEntry describes one completed request in roughly the same
+// shape as an Apache combined log line.
+type RequestLogEntry struct {
+	Method      string
+	Path        string
+	Status      int
+	Bytes       int
+	Duration    time.Duration
+	ReferenceID string
+}
+
+// stdRequestLogger writes entries via the standard logger. It's the
+// logger Serve passes to RequestLoggingMiddleware.
+type stdRequestLogger struct{}
+
+func (stdRequestLogger) Log(e RequestLogEntry) {
+	log.Printf("method=%s path=%s status=%d bytes=%d duration=%s ref-id=%s",
+		e.Method, e.Path, e.Status, e.Bytes, e.Duration, e.ReferenceID)
+}
+
+// RequestLoggingMiddleware assigns every incoming request a reference ID
+// (reusing X-Reference-Id from the caller if present), stashes it on the
+// request context, echoes it back on the response, and logs the completed
+// request through logger once it's done.
+func RequestLoggingMiddleware(logger RequestLogger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			refID := r.Header.Get(referenceIDHeader)
+			if refID == "" {
+				refID = newReferenceID()
+			}
+			w.Header().Set(referenceIDHeader, refID)
+			r = r.WithContext(context.WithValue(r.Context(), referenceIDKey{}, refID))
+
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+
+			logger.Log(RequestLogEntry{
+				Method:      r.Method,
+				Path:        r.URL.Path,
+				Status:      rec.status,
+				Bytes:       rec.bytes,
+				Duration:    time.Since(start),
+				ReferenceID: refID,
+			})
+		})
+	}
+}
+
+// referenceIDFromContext returns the reference ID stashed by
+// RequestLoggingMiddleware, or "" if the context has none.
+func referenceIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(referenceIDKey{}).(string)
+	return id
+}
+
+// newReferenceID returns a short, URL-safe, time-sortable identifier
+// suitable for correlating requests across services.
+func newReferenceID() string {
+	var buf [10]byte
+	binary.BigEndian.PutUint32(buf[:4], uint32(time.Now().Unix()))
+	if _, err := rand.Read(buf[4:]); err != nil {
+		// crypto/rand is not expected to fail; fall back to the
+		// timestamp alone rather than returning an empty ID.
+		return hex.EncodeToString(buf[:4])
+	}
+	return hex.EncodeToString(buf[:])
+}
+
+// statusRecorder wraps an http.ResponseWriter to capture the status code
+// and byte count written, for use by RequestLoggingMiddleware.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
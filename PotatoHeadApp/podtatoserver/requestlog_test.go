@@ -0,0 +1,77 @@
+package podtatoserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type fakeRequestLogger struct {
+	entries []RequestLogEntry
+}
+
+func (f *fakeRequestLogger) Log(e RequestLogEntry) {
+	f.entries = append(f.entries, e)
+}
+
+func TestRequestLoggingMiddleware_GeneratesAndEchoesReferenceID(t *testing.T) {
+	logger := &fakeRequestLogger{}
+	var seenInHandler string
+
+	handler := RequestLoggingMiddleware(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seenInHandler = referenceIDFromContext(r.Context())
+		w.WriteHeader(http.StatusTeapot)
+		_, _ = w.Write([]byte("ok"))
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if seenInHandler == "" {
+		t.Fatal("expected a reference ID to be stashed on the request context")
+	}
+	if got := rec.Header().Get(referenceIDHeader); got != seenInHandler {
+		t.Fatalf("expected response header %q to echo %q, got %q", referenceIDHeader, seenInHandler, got)
+	}
+	if len(logger.entries) != 1 {
+		t.Fatalf("expected exactly one logged entry, got %d", len(logger.entries))
+	}
+	entry := logger.entries[0]
+	if entry.ReferenceID != seenInHandler {
+		t.Fatalf("expected logged ref-id %q to match %q", entry.ReferenceID, seenInHandler)
+	}
+	if entry.Status != http.StatusTeapot {
+		t.Fatalf("expected logged status %d, got %d", http.StatusTeapot, entry.Status)
+	}
+	if entry.Bytes != len("ok") {
+		t.Fatalf("expected logged byte count %d, got %d", len("ok"), entry.Bytes)
+	}
+}
+
+func TestRequestLoggingMiddleware_ReusesIncomingReferenceID(t *testing.T) {
+	logger := &fakeRequestLogger{}
+
+	handler := RequestLoggingMiddleware(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(referenceIDHeader, "caller-supplied-id")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get(referenceIDHeader); got != "caller-supplied-id" {
+		t.Fatalf("expected incoming reference ID to be reused, got %q", got)
+	}
+}
+
+func TestNewReferenceID_ProducesDistinctIDs(t *testing.T) {
+	a := newReferenceID()
+	b := newReferenceID()
+
+	if a == "" || b == "" {
+		t.Fatal("expected non-empty reference IDs")
+	}
+	if a == b {
+		t.Fatalf("expected distinct reference IDs, got %q twice", a)
+	}
+}